@@ -0,0 +1,17 @@
+package client
+
+import (
+	"code.cloudfoundry.org/cfdev/pkg/servicew/config"
+)
+
+// Backend turns a Config into a running background service. ServiceWrapper
+// delegates every operation to one of these rather than always shelling
+// out to a copied swrapper binary, so platforms with a native service
+// manager don't need the binary at all.
+type Backend interface {
+	Install(cfg config.Config) error
+	Uninstall(label string) error
+	Start(label string) error
+	Stop(label string) error
+	IsRunning(label string) (bool, error)
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"code.cloudfoundry.org/cfdev/pkg/servicew/config"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+func newBackend(binaryPath string, workdir string) Backend {
+	return newLaunchdBackend(workdir)
+}
+
+// launchdBackend drives launchd directly instead of shelling out to a
+// copied swrapper binary: it writes the plist into its workdir and
+// controls it with launchctl bootstrap/bootout/kickstart/print.
+type launchdBackend struct {
+	workdir string
+}
+
+func newLaunchdBackend(workdir string) *launchdBackend {
+	return &launchdBackend{workdir: workdir}
+}
+
+var launchdPlistTemplate = template.Must(template.New("plist").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{.Label}}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{.Program}}</string>
+		{{range .Args}}<string>{{.}}</string>
+		{{end}}
+	</array>
+	<key>RunAtLoad</key>
+	<false/>
+	<key>KeepAlive</key>
+	<false/>
+</dict>
+</plist>
+`))
+
+func (b *launchdBackend) Install(cfg config.Config) error {
+	f, err := os.Create(b.plistPath(cfg.Label))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := launchdPlistTemplate.Execute(f, cfg); err != nil {
+		return err
+	}
+
+	domain, err := b.guiDomain()
+	if err != nil {
+		return err
+	}
+
+	output, err := exec.Command("launchctl", "bootstrap", domain, b.plistPath(cfg.Label)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to install '%s': %s: %s", cfg.Label, err, output)
+	}
+
+	return nil
+}
+
+func (b *launchdBackend) Uninstall(label string) error {
+	domain, err := b.guiDomain()
+	if err != nil {
+		return err
+	}
+
+	output, err := exec.Command("launchctl", "bootout", domain+"/"+label).CombinedOutput()
+	if err != nil && !strings.Contains(string(output), "Could not find service") {
+		return fmt.Errorf("failed to uninstall '%s': %s: %s", label, err, output)
+	}
+
+	return os.RemoveAll(b.plistPath(label))
+}
+
+func (b *launchdBackend) Start(label string) error {
+	domain, err := b.guiDomain()
+	if err != nil {
+		return err
+	}
+
+	output, err := exec.Command("launchctl", "kickstart", "-k", domain+"/"+label).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to start '%s': %s: %s", label, err, output)
+	}
+
+	return nil
+}
+
+func (b *launchdBackend) Stop(label string) error {
+	domain, err := b.guiDomain()
+	if err != nil {
+		return err
+	}
+
+	output, err := exec.Command("launchctl", "bootout", domain+"/"+label).CombinedOutput()
+	if err != nil && !strings.Contains(string(output), "Could not find service") {
+		return fmt.Errorf("failed to stop '%s': %s: %s", label, err, output)
+	}
+
+	return nil
+}
+
+func (b *launchdBackend) IsRunning(label string) (bool, error) {
+	domain, err := b.guiDomain()
+	if err != nil {
+		return false, err
+	}
+
+	output, err := exec.Command("launchctl", "print", domain+"/"+label).CombinedOutput()
+	if err != nil {
+		return false, nil
+	}
+
+	return strings.Contains(string(output), "state = running"), nil
+}
+
+func (b *launchdBackend) plistPath(label string) string {
+	return filepath.Join(b.workdir, label+".plist")
+}
+
+func (b *launchdBackend) guiDomain() (string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	return "gui/" + u.Uid, nil
+}
@@ -0,0 +1,25 @@
+package client
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLaunchdPlistTemplateKeepsArgsWithSpacesIntact(t *testing.T) {
+	cfg := fakeConfig{
+		Label:   "com.cfdev.test",
+		Program: "/usr/local/bin/cf dev",
+		Args:    []string{"value with space"},
+	}
+
+	var buf strings.Builder
+	if err := launchdPlistTemplate.Execute(&buf, cfg); err != nil {
+		t.Fatalf("unexpected error executing template: %s", err)
+	}
+
+	rendered := buf.String()
+	wantLine := "<string>value with space</string>"
+	if !strings.Contains(rendered, wantLine) {
+		t.Errorf("rendered plist missing %q, got:\n%s", wantLine, rendered)
+	}
+}
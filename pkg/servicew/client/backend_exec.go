@@ -0,0 +1,154 @@
+package client
+
+import (
+	"code.cloudfoundry.org/cfdev/pkg/servicew/config"
+	"code.cloudfoundry.org/cfdev/pkg/servicew/program"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// execBackend shells out to a copied swrapper binary for every command and
+// parses its stdout for status. It's the original, platform-agnostic
+// implementation, kept as a fallback for platforms without a native
+// service manager backend.
+type execBackend struct {
+	binaryPath string
+	workdir    string
+}
+
+func newExecBackend(binaryPath string, workdir string) *execBackend {
+	return &execBackend{
+		binaryPath: binaryPath,
+		workdir:    workdir,
+	}
+}
+
+func (b *execBackend) Install(cfg config.Config) error {
+	var (
+		swrapperPath     = b.swrapperPath(cfg.Label)
+		definitionConfig = swrapperPath + ".yml"
+	)
+
+	err := copyBinary(b.binaryPath, swrapperPath)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(definitionConfig)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = yaml.NewEncoder(f).Encode(cfg)
+	if err != nil {
+		return err
+	}
+
+	command := exec.Command(swrapperPath, "install")
+	output, err := command.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to install '%s': %s: %s", cfg.Label, err, output)
+	}
+
+	return nil
+}
+
+func (b *execBackend) Uninstall(label string) error {
+	var (
+		swrapperPath     = b.swrapperPath(label)
+		definitionConfig = swrapperPath + ".yml"
+	)
+
+	if b.swrapperNotExist(label) {
+		return nil
+	}
+
+	command := exec.Command(swrapperPath, "uninstall")
+	output, err := command.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to uninstall '%s': %s: %s", label, err, output)
+	}
+
+	err = os.RemoveAll(swrapperPath)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(definitionConfig)
+}
+
+func (b *execBackend) Start(label string) error {
+	command := exec.Command(b.swrapperPath(label), "start")
+	output, err := command.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to start '%s': %s: %s", label, err, output)
+	}
+
+	return nil
+}
+
+func (b *execBackend) Stop(label string) error {
+	if b.swrapperNotExist(label) {
+		return nil
+	}
+
+	command := exec.Command(b.swrapperPath(label), "stop")
+	output, err := command.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to stop '%s': %s: %s", label, err, output)
+	}
+
+	return nil
+}
+
+func (b *execBackend) IsRunning(label string) (bool, error) {
+	if b.swrapperNotExist(label) {
+		return false, nil
+	}
+
+	command := exec.Command(b.swrapperPath(label), "status")
+	output, err := command.Output()
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch status of '%s': %s: %s", label, err, output)
+	}
+
+	return strings.TrimSpace(string(output)) == program.StatusRunning, nil
+}
+
+func (b *execBackend) swrapperNotExist(label string) bool {
+	_, err := os.Stat(b.swrapperPath(label))
+	return os.IsNotExist(err)
+}
+
+func (b *execBackend) swrapperPath(label string) string {
+	splits := strings.Split(label, ".")
+	return filepath.Join(b.workdir, splits[len(splits)-1])
+}
+
+func copyBinary(src string, dest string) error {
+	target, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	err = os.Chmod(dest, 0744)
+	if err != nil {
+		return err
+	}
+
+	binData, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer binData.Close()
+
+	_, err = io.Copy(target, binData)
+	return err
+}
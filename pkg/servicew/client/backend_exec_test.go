@@ -0,0 +1,14 @@
+package client
+
+import "testing"
+
+func TestSwrapperPathUsesTheLastDotSeparatedLabelSegment(t *testing.T) {
+	b := newExecBackend("/path/to/swrapper", "/tmp/workdir")
+
+	got := b.swrapperPath("org.cloudfoundry.cfdev")
+	want := "/tmp/workdir/cfdev"
+
+	if got != want {
+		t.Errorf("swrapperPath(%q) = %q, want %q", "org.cloudfoundry.cfdev", got, want)
+	}
+}
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"code.cloudfoundry.org/cfdev/pkg/servicew/config"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+func newBackend(binaryPath string, workdir string) Backend {
+	return newSystemdBackend(workdir)
+}
+
+// systemdBackend drives systemd --user directly instead of shelling out to
+// a copied swrapper binary: it writes the unit file under
+// ~/.config/systemd/user and controls it with systemctl --user.
+type systemdBackend struct {
+	workdir string
+}
+
+func newSystemdBackend(workdir string) *systemdBackend {
+	return &systemdBackend{workdir: workdir}
+}
+
+var systemdUnitTemplate = template.Must(template.New("unit").Funcs(template.FuncMap{
+	"quoteArg": quoteSystemdArg,
+}).Parse(`[Unit]
+Description={{.Label}}
+
+[Service]
+ExecStart={{quoteArg .Program}}{{range .Args}} {{quoteArg .}}{{end}}
+Restart=no
+
+[Install]
+WantedBy=default.target
+`))
+
+// quoteSystemdArg quotes a single ExecStart= token per systemd's unit-file
+// quoting rules (see systemd.service(5), "Command lines"): systemd splits
+// ExecStart on whitespace, so a Program path or Arg containing a space
+// would otherwise be silently split into extra argv entries instead of
+// passed as one token.
+func quoteSystemdArg(arg string) string {
+	if !strings.ContainsAny(arg, " \t\"\\$") {
+		return arg
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range arg {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+		case '$':
+			b.WriteByte('$')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+func (b *systemdBackend) Install(cfg config.Config) error {
+	if err := os.MkdirAll(b.unitDir(), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(b.unitPath(cfg.Label))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := systemdUnitTemplate.Execute(f, cfg); err != nil {
+		return err
+	}
+
+	output, err := exec.Command("systemctl", "--user", "daemon-reload").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to install '%s': %s: %s", cfg.Label, err, output)
+	}
+
+	output, err = exec.Command("systemctl", "--user", "enable", b.unitName(cfg.Label)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to install '%s': %s: %s", cfg.Label, err, output)
+	}
+
+	return nil
+}
+
+func (b *systemdBackend) Uninstall(label string) error {
+	if b.unitNotExist(label) {
+		return nil
+	}
+
+	output, err := exec.Command("systemctl", "--user", "disable", "--now", b.unitName(label)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to uninstall '%s': %s: %s", label, err, output)
+	}
+
+	if err := os.RemoveAll(b.unitPath(label)); err != nil {
+		return err
+	}
+
+	output, err = exec.Command("systemctl", "--user", "daemon-reload").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to uninstall '%s': %s: %s", label, err, output)
+	}
+
+	return nil
+}
+
+func (b *systemdBackend) Start(label string) error {
+	output, err := exec.Command("systemctl", "--user", "start", b.unitName(label)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to start '%s': %s: %s", label, err, output)
+	}
+
+	return nil
+}
+
+func (b *systemdBackend) Stop(label string) error {
+	if b.unitNotExist(label) {
+		return nil
+	}
+
+	output, err := exec.Command("systemctl", "--user", "stop", b.unitName(label)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to stop '%s': %s: %s", label, err, output)
+	}
+
+	return nil
+}
+
+func (b *systemdBackend) IsRunning(label string) (bool, error) {
+	if b.unitNotExist(label) {
+		return false, nil
+	}
+
+	output, err := exec.Command("systemctl", "--user", "is-active", b.unitName(label)).CombinedOutput()
+	if err != nil {
+		return false, nil
+	}
+
+	return strings.TrimSpace(string(output)) == "active", nil
+}
+
+func (b *systemdBackend) unitNotExist(label string) bool {
+	_, err := os.Stat(b.unitPath(label))
+	return os.IsNotExist(err)
+}
+
+func (b *systemdBackend) unitName(label string) string {
+	return label + ".service"
+}
+
+func (b *systemdBackend) unitPath(label string) string {
+	return filepath.Join(b.unitDir(), b.unitName(label))
+}
+
+func (b *systemdBackend) unitDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "systemd", "user")
+	}
+
+	return filepath.Join(os.Getenv("HOME"), ".config", "systemd", "user")
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuoteSystemdArg(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"simple", "simple"},
+		{"/usr/local/bin/cfdev", "/usr/local/bin/cfdev"},
+		{"has space", `"has space"`},
+		{`has"quote`, `"has\"quote"`},
+		{"has$dollar", `"has$$dollar"`},
+	}
+
+	for _, c := range cases {
+		if got := quoteSystemdArg(c.in); got != c.want {
+			t.Errorf("quoteSystemdArg(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestSystemdUnitTemplateQuotesArgsWithSpaces(t *testing.T) {
+	cfg := fakeConfig{
+		Label:   "com.cfdev.test",
+		Program: "/usr/local/bin/cf dev",
+		Args:    []string{"--flag", "value with space"},
+	}
+
+	var buf strings.Builder
+	if err := systemdUnitTemplate.Execute(&buf, cfg); err != nil {
+		t.Fatalf("unexpected error executing template: %s", err)
+	}
+
+	rendered := buf.String()
+	wantLine := `ExecStart="/usr/local/bin/cf dev" --flag "value with space"`
+	if !strings.Contains(rendered, wantLine) {
+		t.Errorf("rendered unit file missing %q, got:\n%s", wantLine, rendered)
+	}
+}
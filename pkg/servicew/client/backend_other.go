@@ -0,0 +1,10 @@
+// +build !darwin,!linux,!windows
+
+package client
+
+// On platforms without a native backend, fall back to shelling out to a
+// copied swrapper binary, same as every platform did before this package
+// grew native backends.
+func newBackend(binaryPath string, workdir string) Backend {
+	return newExecBackend(binaryPath, workdir)
+}
@@ -0,0 +1,10 @@
+package client
+
+// fakeConfig mirrors the fields of config.Config the per-platform templates
+// read, so platform-specific tests can execute those templates directly
+// without depending on the config package.
+type fakeConfig struct {
+	Label   string
+	Program string
+	Args    []string
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"code.cloudfoundry.org/cfdev/pkg/servicew/config"
+	"fmt"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+func newBackend(binaryPath string, workdir string) Backend {
+	return newWindowsBackend()
+}
+
+// windowsBackend drives the Windows Service Control Manager directly via
+// golang.org/x/sys/windows/svc/mgr instead of shelling out to a copied
+// swrapper binary.
+type windowsBackend struct{}
+
+func newWindowsBackend() *windowsBackend {
+	return &windowsBackend{}
+}
+
+func (b *windowsBackend) Install(cfg config.Config) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.CreateService(cfg.Label, cfg.Program, mgr.Config{
+		DisplayName: cfg.Label,
+		StartType:   mgr.StartManual,
+	}, cfg.Args...)
+	if err != nil {
+		return fmt.Errorf("failed to install '%s': %s", cfg.Label, err)
+	}
+	defer s.Close()
+
+	return nil
+}
+
+func (b *windowsBackend) Uninstall(label string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(label)
+	if err != nil {
+		return nil
+	}
+	defer s.Close()
+
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to uninstall '%s': %s", label, err)
+	}
+
+	return nil
+}
+
+func (b *windowsBackend) Start(label string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(label)
+	if err != nil {
+		return fmt.Errorf("failed to start '%s': %s", label, err)
+	}
+	defer s.Close()
+
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("failed to start '%s': %s", label, err)
+	}
+
+	return nil
+}
+
+func (b *windowsBackend) Stop(label string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(label)
+	if err != nil {
+		return nil
+	}
+	defer s.Close()
+
+	// Ignore the error: Control(Stop) fails if the service is already
+	// stopped, which is not a failure from this method's point of view.
+	s.Control(svc.Stop)
+
+	return nil
+}
+
+func (b *windowsBackend) IsRunning(label string) (bool, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return false, err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(label)
+	if err != nil {
+		return false, nil
+	}
+	defer s.Close()
+
+	status, err := s.Query()
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch status of '%s': %s", label, err)
+	}
+
+	return status.State == svc.Running, nil
+}
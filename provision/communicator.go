@@ -0,0 +1,55 @@
+package provision
+
+import (
+	"github.com/sirupsen/logrus"
+	"io"
+	"time"
+)
+
+// Communicator abstracts the transport used to provision a guest VM. SSH is
+// used for Linux-based stemcells; WinRM is used for Windows-based ones. Both
+// implementations are driven the same way: Run/SendFile/SendData/RetrieveFile
+// do their work synchronously, become no-ops once a call has failed, and
+// record that first failure in Err(), mirroring the rest of
+// this package's fail-fast-and-check-at-the-end style.
+type Communicator interface {
+	Run(command string)
+	SendFile(filePath string, remoteFilePath string)
+	SendData(srcData []byte, remoteFilePath string)
+	SendDir(localDir string, remoteDir string)
+	RetrieveFile(filePath string, remoteFilePath string)
+	RetrieveDir(localDir string, remoteDir string)
+	Err() error
+	Close()
+}
+
+// GuestOSWindows is the guest OS identifier that selects WinRM instead of
+// SSH in NewCommunicator.
+const GuestOSWindows = "windows"
+
+const winrmPort = 5985
+
+// NewCommunicator dials the guest over whichever transport its OS
+// supports: SSH for Linux-based stemcells, WinRM for Windows-based ones.
+// This is the single point that decides which Communicator a deploy uses,
+// so callers don't need to know the guest OS beyond passing it through.
+func NewCommunicator(
+	guestOS string,
+	ip string,
+	key []byte,
+	winrmUsername string,
+	winrmPassword string,
+	timeout time.Duration,
+	stdout io.Writer,
+	stderr io.Writer,
+	knownHostsPath string,
+	allowHostKeyRotation bool,
+	forwardAgent bool,
+	logger *logrus.Logger,
+) (Communicator, error) {
+	if guestOS == GuestOSWindows {
+		return NewWinRM(ip, winrmPort, winrmUsername, winrmPassword, timeout, stdout, stderr, logger)
+	}
+
+	return NewSSH(ip, "9992", key, timeout, stdout, stderr, knownHostsPath, allowHostKeyRotation, forwardAgent, logger)
+}
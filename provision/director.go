@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"code.cloudfoundry.org/cfdev/driver"
 	"code.cloudfoundry.org/cfdev/runner"
+	"github.com/sirupsen/logrus"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -52,7 +53,21 @@ func (c *Controller) DeployBosh() error {
 		return err
 	}
 
-	s, err := NewSSH(ip, "9992", key, 20*time.Second, logFile, logFile)
+	knownHostsPath := filepath.Join(c.Config.StateDir, "known_hosts")
+
+	logger := logrus.New()
+	logger.SetOutput(logFile)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+
+	// DeployBosh always connects to a VM it just (re)created, so a
+	// known_hosts entry that disagrees with the key it now presents is
+	// routine churn, not a MITM: vpnkit/KVM reuse the same address across
+	// recreations, but the host key underneath it is fresh every time.
+	// Allow that one host's entry to rotate instead of wiping the whole
+	// file, which would blind every deploy to a real key mismatch.
+	const allowHostKeyRotation = true
+
+	s, err := NewCommunicator(c.Config.GuestOS, ip, key, c.Config.WinRMUsername, c.Config.WinRMPassword, 20*time.Second, ioutil.Discard, ioutil.Discard, knownHostsPath, allowHostKeyRotation, c.Config.ForwardAgent, logger)
 	if err != nil {
 		return err
 	}
@@ -90,8 +105,8 @@ func (c *Controller) DeployBosh() error {
 	s.Run(command)
 
 	s.RetrieveFile(stateJSONPath, "state.json")
-	if s.Error != nil {
-		return s.Error
+	if s.Err() != nil {
+		return s.Err()
 	}
 
 	if runtime.GOOS == "linux" {
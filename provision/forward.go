@@ -0,0 +1,167 @@
+package provision
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// forwarder tracks a listener and every connection it has spawned, so
+// Close can tear down in-flight forwarded connections instead of only
+// stopping new ones from being accepted.
+type forwarder struct {
+	listener net.Listener
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+func newForwarder(listener net.Listener) *forwarder {
+	return &forwarder{
+		listener: listener,
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+func (f *forwarder) track(conn net.Conn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		conn.Close()
+		return
+	}
+
+	f.conns[conn] = struct{}{}
+}
+
+func (f *forwarder) untrack(conn net.Conn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.conns, conn)
+}
+
+func (f *forwarder) Close() error {
+	f.mu.Lock()
+	f.closed = true
+	conns := f.conns
+	f.conns = nil
+	f.mu.Unlock()
+
+	for conn := range conns {
+		conn.Close()
+	}
+
+	return f.listener.Close()
+}
+
+// LocalForward listens on localAddr and, for each accepted connection,
+// dials remoteAddr through the established SSH session and pipes the two
+// together. It lets callers reach services on the guest (the BOSH
+// Director API, UAA, credhub) without publishing another vpnkit port. The
+// returned Closer shuts down the listener and every in-flight connection.
+func (s *SSH) LocalForward(localAddr string, remoteAddr string) (io.Closer, error) {
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	fwd := newForwarder(listener)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			fwd.track(conn)
+			go s.forwardConn(fwd, conn, remoteAddr)
+		}
+	}()
+
+	return fwd, nil
+}
+
+func (s *SSH) forwardConn(fwd *forwarder, localConn net.Conn, remoteAddr string) {
+	defer fwd.untrack(localConn)
+	defer localConn.Close()
+
+	remoteConn, err := s.client.Dial("tcp", remoteAddr)
+	if err != nil {
+		return
+	}
+	fwd.track(remoteConn)
+	defer fwd.untrack(remoteConn)
+	defer remoteConn.Close()
+
+	done := make(chan struct{}, 2)
+
+	go func() {
+		io.Copy(remoteConn, localConn)
+		done <- struct{}{}
+	}()
+
+	go func() {
+		io.Copy(localConn, remoteConn)
+		done <- struct{}{}
+	}()
+
+	<-done
+}
+
+// RemoteForward listens on remoteAddr on the guest and, for each accepted
+// connection, dials localAddr on the host and pipes the two together. It
+// is the mirror image of LocalForward, letting the guest reach back into
+// host-only services. The returned Closer shuts down the listener and
+// every in-flight connection.
+func (s *SSH) RemoteForward(remoteAddr string, localAddr string) (io.Closer, error) {
+	listener, err := s.client.Listen("tcp", remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	fwd := newForwarder(listener)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			fwd.track(conn)
+			go s.forwardToLocal(fwd, conn, localAddr)
+		}
+	}()
+
+	return fwd, nil
+}
+
+func (s *SSH) forwardToLocal(fwd *forwarder, remoteConn net.Conn, localAddr string) {
+	defer fwd.untrack(remoteConn)
+	defer remoteConn.Close()
+
+	localConn, err := net.Dial("tcp", localAddr)
+	if err != nil {
+		return
+	}
+	fwd.track(localConn)
+	defer fwd.untrack(localConn)
+	defer localConn.Close()
+
+	done := make(chan struct{}, 2)
+
+	go func() {
+		io.Copy(localConn, remoteConn)
+		done <- struct{}{}
+	}()
+
+	go func() {
+		io.Copy(remoteConn, localConn)
+		done <- struct{}{}
+	}()
+
+	<-done
+}
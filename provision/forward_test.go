@@ -0,0 +1,90 @@
+package provision
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+type fakeConn struct {
+	net.Conn
+	closed bool
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+type fakeListener struct {
+	net.Listener
+	closed bool
+}
+
+func (l *fakeListener) Close() error {
+	l.closed = true
+	return nil
+}
+
+func (l *fakeListener) Accept() (net.Conn, error) {
+	return nil, errors.New("fakeListener: no more connections")
+}
+
+func TestForwarderCloseTearsDownInFlightConnections(t *testing.T) {
+	listener := &fakeListener{}
+	fwd := newForwarder(listener)
+
+	a := &fakeConn{}
+	b := &fakeConn{}
+	fwd.track(a)
+	fwd.track(b)
+
+	if err := fwd.Close(); err != nil {
+		t.Fatalf("unexpected error closing forwarder: %s", err)
+	}
+
+	if !a.closed {
+		t.Error("expected connection a to be closed")
+	}
+
+	if !b.closed {
+		t.Error("expected connection b to be closed")
+	}
+
+	if !listener.closed {
+		t.Error("expected listener to be closed")
+	}
+}
+
+func TestForwarderUntrackRemovesAClosedConnection(t *testing.T) {
+	listener := &fakeListener{}
+	fwd := newForwarder(listener)
+
+	a := &fakeConn{}
+	fwd.track(a)
+	fwd.untrack(a)
+
+	if err := fwd.Close(); err != nil {
+		t.Fatalf("unexpected error closing forwarder: %s", err)
+	}
+
+	if a.closed {
+		t.Error("expected an untracked connection to be left alone by Close")
+	}
+}
+
+func TestForwarderTrackAfterCloseClosesImmediately(t *testing.T) {
+	listener := &fakeListener{}
+	fwd := newForwarder(listener)
+
+	if err := fwd.Close(); err != nil {
+		t.Fatalf("unexpected error closing forwarder: %s", err)
+	}
+
+	a := &fakeConn{}
+	fwd.track(a)
+
+	if !a.closed {
+		t.Error("expected a connection tracked after Close to be closed immediately")
+	}
+}
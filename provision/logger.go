@@ -0,0 +1,162 @@
+package provision
+
+import (
+	"bytes"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// lineWriter turns a raw byte stream into line-buffered, structured log
+// entries instead of an opaque blob, so deploy-bosh.log becomes a
+// greppable JSON stream rather than interleaved command output.
+type lineWriter struct {
+	logger *logrus.Logger
+	fields logrus.Fields
+	buf    []byte
+}
+
+func newLineWriter(logger *logrus.Logger, command string, sessionID string, stream string) *lineWriter {
+	return &lineWriter{
+		logger: logger,
+		fields: logrus.Fields{"command": command, "session_id": sessionID, "stream": stream},
+	}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		w.logger.WithFields(w.fields).Info(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush logs whatever's left in the buffer. A session's final line rarely
+// ends in '\n', so without this the last (often most important) line of
+// output would never reach the log.
+func (w *lineWriter) Flush() {
+	if len(w.buf) == 0 {
+		return
+	}
+
+	w.logger.WithFields(w.fields).Info(string(w.buf))
+	w.buf = nil
+}
+
+func (s *SSH) nextSessionID() string {
+	n := atomic.AddInt64(&s.sessionSeq, 1)
+	return "ssh-" + strconv.FormatInt(n, 10)
+}
+
+// logStart emits a start event for command, tagged with sessionID. It is a
+// no-op when no logger is configured, so Logger remains fully opt-in.
+func (s *SSH) logStart(command string, sessionID string) {
+	if s.logger == nil {
+		return
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"command":    command,
+		"session_id": sessionID,
+	}).Info("start")
+}
+
+// logEnd emits an end event for command, tagged with sessionID, including
+// the elapsed time and exit status of the call.
+func (s *SSH) logEnd(command string, sessionID string, start time.Time, err error) {
+	if s.logger == nil {
+		return
+	}
+
+	fields := logrus.Fields{
+		"command":     command,
+		"session_id":  sessionID,
+		"elapsed_ms":  time.Since(start).Milliseconds(),
+		"exit_status": exitStatus(err),
+	}
+
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+
+	s.logger.WithFields(fields).Info("end")
+}
+
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		return exitErr.ExitStatus()
+	}
+
+	return -1
+}
+
+func (w *WinRM) nextSessionID() string {
+	n := atomic.AddInt64(&w.sessionSeq, 1)
+	return "winrm-" + strconv.FormatInt(n, 10)
+}
+
+// logStart emits a start event for command, tagged with sessionID. It is a
+// no-op when no logger is configured, so Logger remains fully opt-in.
+func (w *WinRM) logStart(command string, sessionID string) {
+	if w.logger == nil {
+		return
+	}
+
+	w.logger.WithFields(logrus.Fields{
+		"command":    command,
+		"session_id": sessionID,
+	}).Info("start")
+}
+
+// logEnd emits an end event for command, tagged with sessionID, including
+// the elapsed time of the call.
+func (w *WinRM) logEnd(command string, sessionID string, start time.Time, err error) {
+	if w.logger == nil {
+		return
+	}
+
+	fields := logrus.Fields{
+		"command":    command,
+		"session_id": sessionID,
+		"elapsed_ms": time.Since(start).Milliseconds(),
+	}
+
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+
+	w.logger.WithFields(fields).Info("end")
+}
+
+// sessionWriters mirrors SSH.sessionWriters: the raw io.Writers passed to
+// NewWinRM by default (flush is a no-op), or line-buffered logrus entries
+// when a Logger was configured (flush emits whatever partial line is still
+// buffered, which would otherwise be lost).
+func (w *WinRM) sessionWriters(command string, sessionID string) (io.Writer, io.Writer, func()) {
+	if w.logger == nil {
+		return w.stdout, w.stderr, func() {}
+	}
+
+	stdout := newLineWriter(w.logger, command, sessionID, "stdout")
+	stderr := newLineWriter(w.logger, command, sessionID, "stderr")
+
+	return stdout, stderr, func() {
+		stdout.Flush()
+		stderr.Flush()
+	}
+}
@@ -3,20 +3,31 @@ package provision
 import (
 	"bytes"
 	"fmt"
+	"github.com/pkg/sftp"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
 	"io"
 	"io/ioutil"
 	"net"
 	"os"
+	slashpath "path"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 type SSH struct {
-	client  *ssh.Client
-	stdout  io.Writer
-	stderr  io.Writer
-	Error   error
+	client       *ssh.Client
+	sftp         *sftp.Client
+	stdout       io.Writer
+	stderr       io.Writer
+	agentClient  agent.Agent
+	forwardAgent bool
+	logger       *logrus.Logger
+	sessionSeq   int64
+	Error        error
 }
 
 func NewSSH(
@@ -26,39 +37,121 @@ func NewSSH(
 	timeout time.Duration,
 	stdout io.Writer,
 	stderr io.Writer,
+	knownHostsPath string,
+	allowHostKeyRotation bool,
+	forwardAgent bool,
+	logger *logrus.Logger,
 ) (*SSH, error) {
-	client, err := waitForSSH(ip, port, key, timeout)
+	client, err := waitForSSH(ip, port, key, timeout, knownHostsPath, allowHostKeyRotation)
 	if err != nil {
 		return nil, err
 	}
 
-	return &SSH{
-		client:  client,
-		stdout:  stdout,
-		stderr:  stderr,
-	}, nil
+	// The remote may not have an SFTP subsystem configured (e.g. a minimal
+	// stemcell); fall back to SCP (and cat, for retrieval) over a raw
+	// session in that case.
+	sftpClient, _ := sftp.NewClient(client)
+
+	s := &SSH{
+		client:       client,
+		sftp:         sftpClient,
+		stdout:       stdout,
+		stderr:       stderr,
+		forwardAgent: forwardAgent,
+		logger:       logger,
+	}
+
+	if forwardAgent {
+		s.agentClient, err = dialLocalAgent()
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("could not forward ssh agent: %s", err)
+		}
+
+		if err := agent.ForwardToAgent(client, s.agentClient); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("could not forward ssh agent: %s", err)
+		}
+	}
+
+	return s, nil
+}
+
+func dialLocalAgent() (agent.Agent, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, fmt.Errorf("SSH_AUTH_SOCK is not set")
+	}
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+
+	return agent.NewClient(conn), nil
 }
 
 func (s *SSH) Close() {
+	if s.sftp != nil {
+		s.sftp.Close()
+	}
 	s.client.Close()
 }
 
+func (s *SSH) Err() error {
+	return s.Error
+}
+
 func (s *SSH) Run(command string) {
 	if s.Error != nil {
 		return
 	}
 
+	sessionID := s.nextSessionID()
+	start := time.Now()
+	s.logStart(command, sessionID)
+
 	session, err := s.client.NewSession()
 	if err != nil {
 		s.Error = err
+		s.logEnd(command, sessionID, start, s.Error)
 		return
 	}
 	defer session.Close()
 
-	session.Stdout = s.stdout
-	session.Stderr = s.stderr
+	if s.forwardAgent {
+		if err := agent.RequestAgentForwarding(session); err != nil {
+			s.Error = err
+			s.logEnd(command, sessionID, start, s.Error)
+			return
+		}
+	}
+
+	var flush func()
+	session.Stdout, session.Stderr, flush = s.sessionWriters(command, sessionID)
+	defer flush()
 
 	s.Error = session.Run(command)
+	s.logEnd(command, sessionID, start, s.Error)
+}
+
+// sessionWriters returns the stdout/stderr writers to attach to a session,
+// plus a flush func that must be called once the session is done: the raw
+// io.Writers passed to NewSSH by default (flush is a no-op), or
+// line-buffered logrus entries when a Logger was configured (flush emits
+// whatever partial line is still buffered, which would otherwise be lost).
+func (s *SSH) sessionWriters(command string, sessionID string) (io.Writer, io.Writer, func()) {
+	if s.logger == nil {
+		return s.stdout, s.stderr, func() {}
+	}
+
+	stdout := newLineWriter(s.logger, command, sessionID, "stdout")
+	stderr := newLineWriter(s.logger, command, sessionID, "stderr")
+
+	return stdout, stderr, func() {
+		stdout.Flush()
+		stderr.Flush()
+	}
 }
 
 func (s *SSH) SendFile(filePath string, remoteFilePath string) {
@@ -66,21 +159,56 @@ func (s *SSH) SendFile(filePath string, remoteFilePath string) {
 		return
 	}
 
+	sessionID := s.nextSessionID()
+	start := time.Now()
+	s.logStart(remoteFilePath, sessionID)
+
 	data, err := ioutil.ReadFile(filePath)
 	if err != nil {
 		s.Error = err
+		s.logEnd(remoteFilePath, sessionID, start, s.Error)
 		return
 	}
 
-	s.SendData(data, remoteFilePath)
+	s.sendData(data, remoteFilePath, sessionID)
+	s.logEnd(remoteFilePath, sessionID, start, s.Error)
 }
 
-
 func (s *SSH) SendData(srcData []byte, remoteFilePath string) {
 	if s.Error != nil {
 		return
 	}
 
+	s.sendData(srcData, remoteFilePath, s.nextSessionID())
+}
+
+func (s *SSH) sendData(srcData []byte, remoteFilePath string, sessionID string) {
+	if s.sftp != nil {
+		s.sendDataSFTP(srcData, remoteFilePath)
+		return
+	}
+
+	s.sendDataSCP(srcData, remoteFilePath, sessionID)
+}
+
+func (s *SSH) sendDataSFTP(srcData []byte, remoteFilePath string) {
+	f, err := s.sftp.Create(remoteFilePath)
+	if err != nil {
+		s.Error = err
+		return
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, bytes.NewReader(srcData))
+	if err != nil {
+		s.Error = err
+		return
+	}
+
+	s.Error = f.Chmod(0755)
+}
+
+func (s *SSH) sendDataSCP(srcData []byte, remoteFilePath string, sessionID string) {
 	bytesReader := bytes.NewReader(srcData)
 	session, err := s.client.NewSession()
 	if err != nil {
@@ -89,8 +217,9 @@ func (s *SSH) SendData(srcData []byte, remoteFilePath string) {
 	}
 	defer session.Close()
 
-	session.Stdout = s.stdout
-	session.Stderr = s.stderr
+	var flush func()
+	session.Stdout, session.Stderr, flush = s.sessionWriters(remoteFilePath, sessionID)
+	defer flush()
 
 	go func() {
 		w, _ := session.StdinPipe()
@@ -111,11 +240,118 @@ func (s *SSH) SendData(srcData []byte, remoteFilePath string) {
 	session.Run(command)
 }
 
+// remoteTreePath maps a path found while walking localDir to its
+// destination under remoteDir, always joining with forward slashes since
+// the remote may be a Windows host. filepath.Join/filepath.ToSlash are no
+// help here: on the Linux/macOS hosts cfdev actually builds on, the OS
+// separator is already "/", so they never touch a literal backslash that
+// arrived in remoteDir itself (e.g. "C:\dest"). Normalize remoteDir first.
+func remoteTreePath(localDir string, remoteDir string, path string) (string, error) {
+	relPath, err := filepath.Rel(localDir, path)
+	if err != nil {
+		return "", err
+	}
+
+	remoteDir = strings.Replace(remoteDir, `\`, "/", -1)
+
+	return slashpath.Join(remoteDir, filepath.ToSlash(relPath)), nil
+}
+
+// localTreePath is the mirror of remoteTreePath: it maps a path found
+// while walking remoteDir to its destination under localDir.
+func localTreePath(remoteDir string, localDir string, remotePath string) (string, error) {
+	relPath, err := filepath.Rel(remoteDir, remotePath)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(localDir, relPath), nil
+}
+
+// SendDir copies localDir's tree to remoteDir over SFTP, preserving file
+// modes. It requires the remote to have an SFTP subsystem; there is no SCP
+// fallback for directories.
+func (s *SSH) SendDir(localDir string, remoteDir string) {
+	if s.Error != nil {
+		return
+	}
+
+	if s.sftp == nil {
+		s.Error = fmt.Errorf("cannot send directory %s: remote has no SFTP subsystem", localDir)
+		return
+	}
+
+	s.Error = filepath.Walk(localDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		remotePath, err := remoteTreePath(localDir, remoteDir, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return s.sftp.MkdirAll(remotePath)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		remoteFile, err := s.sftp.Create(remotePath)
+		if err != nil {
+			return err
+		}
+		defer remoteFile.Close()
+
+		if _, err := io.Copy(remoteFile, bytes.NewReader(data)); err != nil {
+			return err
+		}
+
+		return remoteFile.Chmod(info.Mode())
+	})
+}
+
 func (s *SSH) RetrieveFile(filePath string, remoteFilePath string) {
 	if s.Error != nil {
 		return
 	}
 
+	sessionID := s.nextSessionID()
+	start := time.Now()
+	s.logStart(remoteFilePath, sessionID)
+
+	if s.sftp != nil {
+		s.retrieveFileSFTP(filePath, remoteFilePath)
+	} else {
+		s.retrieveFileSCP(filePath, remoteFilePath, sessionID)
+	}
+
+	s.logEnd(remoteFilePath, sessionID, start, s.Error)
+}
+
+func (s *SSH) retrieveFileSFTP(filePath string, remoteFilePath string) {
+	remoteFile, err := s.sftp.Open(remoteFilePath)
+	if err != nil {
+		s.Error = err
+		return
+	}
+	defer remoteFile.Close()
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		s.Error = err
+		return
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, remoteFile)
+	s.Error = err
+}
+
+func (s *SSH) retrieveFileSCP(filePath string, remoteFilePath string, sessionID string) {
 	f, err := os.Create(filePath)
 	if err != nil {
 		s.Error = err
@@ -130,28 +366,92 @@ func (s *SSH) RetrieveFile(filePath string, remoteFilePath string) {
 	}
 	defer session.Close()
 
+	_, stderr, flush := s.sessionWriters(remoteFilePath, sessionID)
 	session.Stdout = f
-	session.Stderr = s.stderr
+	session.Stderr = stderr
+	defer flush()
 
 	s.Error = session.Run("cat " + remoteFilePath)
 }
 
-func waitForSSH(ip string, port string, privateKey []byte, timeout time.Duration) (*ssh.Client, error) {
+// RetrieveDir copies remoteDir's tree to localDir over SFTP, preserving
+// file modes.
+func (s *SSH) RetrieveDir(localDir string, remoteDir string) {
+	if s.Error != nil {
+		return
+	}
+
+	if s.sftp == nil {
+		s.Error = fmt.Errorf("cannot retrieve directory %s: remote has no SFTP subsystem", remoteDir)
+		return
+	}
+
+	walker := s.sftp.Walk(remoteDir)
+	for walker.Step() {
+		if walker.Err() != nil {
+			s.Error = walker.Err()
+			return
+		}
+
+		localPath, err := localTreePath(remoteDir, localDir, walker.Path())
+		if err != nil {
+			s.Error = err
+			return
+		}
+
+		info := walker.Stat()
+
+		if info.IsDir() {
+			if err := os.MkdirAll(localPath, info.Mode()); err != nil {
+				s.Error = err
+				return
+			}
+			continue
+		}
+
+		if err := s.retrieveOne(localPath, walker.Path(), info.Mode()); err != nil {
+			s.Error = err
+			return
+		}
+	}
+}
+
+func (s *SSH) retrieveOne(localPath string, remotePath string, mode os.FileMode) error {
+	remoteFile, err := s.sftp.Open(remotePath)
+	if err != nil {
+		return err
+	}
+	defer remoteFile.Close()
+
+	f, err := os.OpenFile(localPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, remoteFile)
+	return err
+}
+
+func waitForSSH(ip string, port string, privateKey []byte, timeout time.Duration, knownHostsPath string, allowHostKeyRotation bool) (*ssh.Client, error) {
 	signer, err := ssh.ParsePrivateKey(privateKey)
 	if err != nil {
 		return nil, fmt.Errorf("could not parse private key: %s", err)
 	}
 
+	hostKeyCallback, err := trustOnFirstUseCallback(knownHostsPath, allowHostKeyRotation)
+	if err != nil {
+		return nil, fmt.Errorf("could not set up known_hosts verification: %s", err)
+	}
+
 	var (
 		clientChan = make(chan *ssh.Client, 1)
 		errorChan  = make(chan error, 1)
 		config     = &ssh.ClientConfig{
-			User:    "root",
-			Auth:    []ssh.AuthMethod{ssh.PublicKeys(signer)},
-			Timeout: 10 * time.Second,
-			HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-				return nil
-			},
+			User:            "root",
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			Timeout:         10 * time.Second,
+			HostKeyCallback: hostKeyCallback,
 		}
 	)
 
@@ -182,3 +482,90 @@ func waitForSSH(ip string, port string, privateKey []byte, timeout time.Duration
 
 	return <-clientChan, <-errorChan
 }
+
+// trustOnFirstUseCallback verifies host keys against knownHostsPath,
+// creating it if missing, and automatically appending the key for any
+// host seen for the first time. This closes the trust-on-first-use gap
+// without requiring callers to pre-seed a known_hosts file.
+//
+// allowHostKeyRotation controls what happens when a host is known under a
+// different key than the one it now presents. Ordinarily that's refused,
+// since it's indistinguishable from a MITM. DeployBosh is the one caller
+// that can pass true: it always connects to a VM it just (re)created, so a
+// stale entry at that host is routine churn (vpnkit/KVM reuse the same IP
+// across recreations) rather than a real attack. Only that host's entry is
+// replaced, leaving every other recorded host key, and the MITM check for
+// anyone else, untouched.
+func trustOnFirstUseCallback(knownHostsPath string, allowHostKeyRotation bool) (ssh.HostKeyCallback, error) {
+	if _, err := os.Stat(knownHostsPath); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(knownHostsPath), 0700); err != nil {
+			return nil, err
+		}
+
+		f, err := os.OpenFile(knownHostsPath, os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		f.Close()
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		callback, err := knownhosts.New(knownHostsPath)
+		if err != nil {
+			return err
+		}
+
+		err = callback(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		if _, ok := err.(*knownhosts.KeyError); !ok {
+			return err
+		}
+
+		if keyErr := err.(*knownhosts.KeyError); len(keyErr.Want) > 0 {
+			if !allowHostKeyRotation {
+				// The host is known under a different key: a real MITM or
+				// host-key-rotation scenario, not first use. Don't auto-trust.
+				return err
+			}
+
+			if err := removeHostKeyEntries(knownHostsPath, hostname); err != nil {
+				return err
+			}
+		}
+
+		f, err := os.OpenFile(knownHostsPath, os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+		_, err = fmt.Fprintln(f, line)
+		return err
+	}, nil
+}
+
+// removeHostKeyEntries drops every known_hosts line recorded for hostname,
+// leaving every other host's entries untouched.
+func removeHostKeyEntries(knownHostsPath string, hostname string) error {
+	data, err := ioutil.ReadFile(knownHostsPath)
+	if err != nil {
+		return err
+	}
+
+	normalized := knownhosts.Normalize(hostname)
+
+	var kept []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == normalized {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	return ioutil.WriteFile(knownHostsPath, []byte(strings.Join(kept, "\n")), 0600)
+}
@@ -0,0 +1,52 @@
+package provision
+
+import "testing"
+
+func TestRemoteTreePath(t *testing.T) {
+	cases := []struct {
+		localDir  string
+		remoteDir string
+		path      string
+		expected  string
+	}{
+		{"/home/user/src", "/tmp/dest", "/home/user/src", "/tmp/dest"},
+		{"/home/user/src", "/tmp/dest", "/home/user/src/file.txt", "/tmp/dest/file.txt"},
+		{"/home/user/src", "/tmp/dest", "/home/user/src/nested/file.txt", "/tmp/dest/nested/file.txt"},
+		{"/home/user/src", `C:\dest`, "/home/user/src/nested/file.txt", "C:/dest/nested/file.txt"},
+	}
+
+	for _, c := range cases {
+		actual, err := remoteTreePath(c.localDir, c.remoteDir, c.path)
+		if err != nil {
+			t.Fatalf("unexpected error for %+v: %s", c, err)
+		}
+
+		if actual != c.expected {
+			t.Errorf("remoteTreePath(%q, %q, %q) = %q, want %q", c.localDir, c.remoteDir, c.path, actual, c.expected)
+		}
+	}
+}
+
+func TestLocalTreePath(t *testing.T) {
+	cases := []struct {
+		remoteDir  string
+		localDir   string
+		remotePath string
+		expected   string
+	}{
+		{"/tmp/src", "/home/user/dest", "/tmp/src", "/home/user/dest"},
+		{"/tmp/src", "/home/user/dest", "/tmp/src/file.txt", "/home/user/dest/file.txt"},
+		{"/tmp/src", "/home/user/dest", "/tmp/src/nested/file.txt", "/home/user/dest/nested/file.txt"},
+	}
+
+	for _, c := range cases {
+		actual, err := localTreePath(c.remoteDir, c.localDir, c.remotePath)
+		if err != nil {
+			t.Fatalf("unexpected error for %+v: %s", c, err)
+		}
+
+		if actual != c.expected {
+			t.Errorf("localTreePath(%q, %q, %q) = %q, want %q", c.remoteDir, c.localDir, c.remotePath, actual, c.expected)
+		}
+	}
+}
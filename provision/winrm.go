@@ -0,0 +1,319 @@
+package provision
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/masterzen/winrm"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WinRM provisions Windows-based stemcells/VMs over WinRM, the Windows
+// analogue to SSH. It implements Communicator the same way SSH does so
+// callers like DeployBosh don't need to know which guest OS they're
+// talking to.
+type WinRM struct {
+	client     *winrm.Client
+	stdout     io.Writer
+	stderr     io.Writer
+	logger     *logrus.Logger
+	sessionSeq int64
+	Error      error
+}
+
+func NewWinRM(
+	ip string,
+	port int,
+	username string,
+	password string,
+	timeout time.Duration,
+	stdout io.Writer,
+	stderr io.Writer,
+	logger *logrus.Logger,
+) (*WinRM, error) {
+	client, err := waitForWinRM(ip, port, username, password, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WinRM{
+		client: client,
+		stdout: stdout,
+		stderr: stderr,
+		logger: logger,
+	}, nil
+}
+
+func (w *WinRM) Close() {}
+
+func (w *WinRM) Err() error {
+	return w.Error
+}
+
+func (w *WinRM) Run(command string) {
+	if w.Error != nil {
+		return
+	}
+
+	sessionID := w.nextSessionID()
+	start := time.Now()
+	w.logStart(command, sessionID)
+
+	stdout, stderr, flush := w.sessionWriters(command, sessionID)
+	defer flush()
+
+	exitCode, err := w.client.Run(command, stdout, stderr)
+	if err != nil {
+		w.Error = err
+		w.logEnd(command, sessionID, start, w.Error)
+		return
+	}
+
+	if exitCode != 0 {
+		w.Error = fmt.Errorf("command exited with code %d: %s", exitCode, command)
+	}
+	w.logEnd(command, sessionID, start, w.Error)
+}
+
+func (w *WinRM) SendFile(filePath string, remoteFilePath string) {
+	if w.Error != nil {
+		return
+	}
+
+	sessionID := w.nextSessionID()
+	start := time.Now()
+	w.logStart(remoteFilePath, sessionID)
+
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		w.Error = err
+		w.logEnd(remoteFilePath, sessionID, start, w.Error)
+		return
+	}
+
+	w.sendData(data, remoteFilePath, sessionID)
+	w.logEnd(remoteFilePath, sessionID, start, w.Error)
+}
+
+// SendData writes srcData to remoteFilePath by base64-encoding it and
+// appending it in chunks via PowerShell, since WinRM has no native file
+// transfer and cmd.exe command lines are capped at 8191 characters.
+func (w *WinRM) SendData(srcData []byte, remoteFilePath string) {
+	if w.Error != nil {
+		return
+	}
+
+	w.sendData(srcData, remoteFilePath, w.nextSessionID())
+}
+
+func (w *WinRM) sendData(srcData []byte, remoteFilePath string, sessionID string) {
+	const chunkSize = 1024
+
+	stdout, stderr, flush := w.sessionWriters(remoteFilePath, sessionID)
+	defer flush()
+
+	// Both the final target and the base64 staging file must be cleared up
+	// front: Add-Content below appends, so leftover staging content from a
+	// previous SendData to the same path would corrupt the decoded result.
+	deleteCmd := fmt.Sprintf(
+		`powershell -Command "if (Test-Path '%s') { Remove-Item '%s' }; if (Test-Path '%s') { Remove-Item '%s' }"`,
+		remoteFilePath, remoteFilePath, remoteFilePath+".b64", remoteFilePath+".b64",
+	)
+	if exitCode, err := w.client.Run(deleteCmd, stdout, stderr); err != nil || exitCode != 0 {
+		w.Error = fmt.Errorf("failed to clear remote file %s: %s", remoteFilePath, err)
+		return
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(srcData)
+
+	for len(encoded) > 0 {
+		n := chunkSize
+		if n > len(encoded) {
+			n = len(encoded)
+		}
+
+		chunk := encoded[:n]
+		encoded = encoded[n:]
+
+		appendCmd := fmt.Sprintf(`powershell -Command "Add-Content -Path '%s' -Value '%s' -Encoding ASCII -NoNewline"`, remoteFilePath+".b64", chunk)
+		if exitCode, err := w.client.Run(appendCmd, stdout, stderr); err != nil || exitCode != 0 {
+			w.Error = fmt.Errorf("failed to send data to %s: %s", remoteFilePath, err)
+			return
+		}
+	}
+
+	decodeCmd := fmt.Sprintf(
+		`powershell -Command "[IO.File]::WriteAllBytes('%s', [Convert]::FromBase64String([IO.File]::ReadAllText('%s'))); Remove-Item '%s'"`,
+		remoteFilePath, remoteFilePath+".b64", remoteFilePath+".b64",
+	)
+
+	exitCode, err := w.client.Run(decodeCmd, stdout, stderr)
+	if err != nil {
+		w.Error = err
+		return
+	}
+	if exitCode != 0 {
+		w.Error = fmt.Errorf("failed to decode remote file %s", remoteFilePath)
+	}
+}
+
+// SendDir copies localDir's tree to remoteDir one file at a time, since
+// WinRM has no directory-aware transfer primitive the way SFTP does.
+func (w *WinRM) SendDir(localDir string, remoteDir string) {
+	if w.Error != nil {
+		return
+	}
+
+	w.Error = filepath.Walk(localDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(localDir, path)
+		if err != nil {
+			return err
+		}
+
+		remotePath := remoteDir + `\` + filepath.ToSlash(relPath)
+
+		if info.IsDir() {
+			mkdirCmd := fmt.Sprintf(`powershell -Command "New-Item -ItemType Directory -Force -Path '%s'"`, remotePath)
+			if exitCode, err := w.client.Run(mkdirCmd, w.stdout, w.stderr); err != nil || exitCode != 0 {
+				return fmt.Errorf("failed to create remote directory %s: %s", remotePath, err)
+			}
+			return nil
+		}
+
+		w.SendFile(path, remotePath)
+		return w.Error
+	})
+}
+
+func (w *WinRM) RetrieveFile(filePath string, remoteFilePath string) {
+	if w.Error != nil {
+		return
+	}
+
+	sessionID := w.nextSessionID()
+	start := time.Now()
+	w.logStart(remoteFilePath, sessionID)
+
+	w.retrieveFile(filePath, remoteFilePath, sessionID)
+
+	w.logEnd(remoteFilePath, sessionID, start, w.Error)
+}
+
+func (w *WinRM) retrieveFile(filePath string, remoteFilePath string, sessionID string) {
+	f, err := os.Create(filePath)
+	if err != nil {
+		w.Error = err
+		return
+	}
+	defer f.Close()
+
+	_, stderr, flush := w.sessionWriters(remoteFilePath, sessionID)
+	defer flush()
+
+	catCmd := fmt.Sprintf(`powershell -Command "[Convert]::ToBase64String([IO.File]::ReadAllBytes('%s'))"`, remoteFilePath)
+
+	var out bytes.Buffer
+	exitCode, err := w.client.Run(catCmd, &out, stderr)
+	if err != nil {
+		w.Error = err
+		return
+	}
+	if exitCode != 0 {
+		w.Error = fmt.Errorf("failed to read remote file %s", remoteFilePath)
+		return
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(out.String()))
+	if err != nil {
+		w.Error = err
+		return
+	}
+
+	_, err = f.Write(data)
+	w.Error = err
+}
+
+// RetrieveDir lists remoteDir with PowerShell and retrieves each file it
+// finds into localDir, one file at a time.
+func (w *WinRM) RetrieveDir(localDir string, remoteDir string) {
+	if w.Error != nil {
+		return
+	}
+
+	listCmd := fmt.Sprintf(`powershell -Command "Get-ChildItem -Path '%s' -Recurse -File | ForEach-Object { $_.FullName.Substring('%s'.Length + 1) }"`, remoteDir, remoteDir)
+
+	var out bytes.Buffer
+	exitCode, err := w.client.Run(listCmd, &out, w.stderr)
+	if err != nil {
+		w.Error = err
+		return
+	}
+	if exitCode != 0 {
+		w.Error = fmt.Errorf("failed to list remote directory %s", remoteDir)
+		return
+	}
+
+	for _, relPath := range strings.Split(strings.TrimSpace(out.String()), "\r\n") {
+		relPath = strings.TrimSpace(relPath)
+		if relPath == "" {
+			continue
+		}
+
+		localPath := filepath.Join(localDir, filepath.FromSlash(strings.Replace(relPath, `\`, "/", -1)))
+		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+			w.Error = err
+			return
+		}
+
+		w.RetrieveFile(localPath, remoteDir+`\`+relPath)
+		if w.Error != nil {
+			return
+		}
+	}
+}
+
+func waitForWinRM(ip string, port int, username string, password string, timeout time.Duration) (*winrm.Client, error) {
+	endpoint := winrm.NewEndpoint(ip, port, false, false, nil, nil, nil, timeout)
+
+	var (
+		clientChan = make(chan *winrm.Client, 1)
+		errorChan  = make(chan error, 1)
+	)
+
+	go func() {
+		var (
+			ticker   = time.NewTicker(time.Second)
+			deadline = time.After(timeout)
+			err      error
+		)
+
+		for {
+			select {
+			case <-ticker.C:
+				var client *winrm.Client
+				client, err = winrm.NewClient(endpoint, username, password)
+				if err == nil {
+					clientChan <- client
+					errorChan <- nil
+					return
+				}
+			case <-deadline:
+				clientChan <- nil
+				errorChan <- fmt.Errorf("winrm connection timed out: %s", err)
+				return
+			}
+		}
+	}()
+
+	return <-clientChan, <-errorChan
+}